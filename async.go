@@ -0,0 +1,380 @@
+package honeybadger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultQueueSize is the number of notices buffered by the background
+	// dispatcher when Client.QueueSize is unset.
+	DefaultQueueSize = 100
+
+	// DefaultWorkers is the number of dispatcher goroutines started when
+	// Client.Workers is unset.
+	DefaultWorkers = 1
+
+	// DefaultFlushInterval is how long a worker holds a partial batch before
+	// sending it when Client.FlushInterval is unset.
+	DefaultFlushInterval = 5 * time.Second
+
+	// DefaultMaxElapsedTime bounds retries when Client.MaxElapsedTime is
+	// unset.
+	DefaultMaxElapsedTime = 5 * time.Minute
+
+	// DefaultStopTimeout bounds how long Stop waits to drain the queue when
+	// Client.StopTimeout is unset.
+	DefaultStopTimeout = 5 * time.Second
+
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// Stats reports counters maintained by the background dispatcher.
+type Stats struct {
+	// Dropped is the number of notices discarded because the queue was full,
+	// whether queued by ReportAsync or by the HTTP middleware.
+	Dropped uint64
+}
+
+// dispatcher holds the state of a running background worker pool. It is
+// created by Start and torn down by Stop.
+type dispatcher struct {
+	queue  chan map[string]interface{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// drainCtx bounds the final flush runWorker does after cancel, so that
+	// delivery isn't forced to use the now-cancelled worker context. Stop
+	// sets it before calling cancel, which happens-before runWorker
+	// observes ctx.Done(), so no further synchronization is needed.
+	drainCtx context.Context
+}
+
+// Start launches the background dispatcher that powers ReportAsync. It
+// starts Client.Workers goroutines (DefaultWorkers if unset) that deliver
+// notices buffered on a queue of Client.QueueSize (DefaultQueueSize if
+// unset). The workers run until ctx is done or Stop is called. Start is a
+// no-op if the dispatcher is already running.
+func (c *Client) Start(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dispatcher != nil {
+		return
+	}
+
+	queueSize := c.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	dctx, cancel := context.WithCancel(ctx)
+	d := &dispatcher{
+		queue:  make(chan map[string]interface{}, queueSize),
+		cancel: cancel,
+	}
+	c.dispatcher = d
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go c.runWorker(dctx, d)
+	}
+}
+
+// Stop signals the dispatcher started by Start to shut down. It gives
+// workers up to Client.StopTimeout (DefaultStopTimeout if unset) to finish
+// delivering whatever is already queued, then returns. It is safe to call
+// Stop without a prior call to Start.
+func (c *Client) Stop() {
+	c.mu.Lock()
+	d := c.dispatcher
+	c.dispatcher = nil
+	c.mu.Unlock()
+
+	if d == nil {
+		return
+	}
+
+	timeout := c.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+
+	// d.cancel stops runWorker's select loop, not any in-flight delivery:
+	// the final drain below runs on its own context, so the notices
+	// already queued still get a real chance to send rather than failing
+	// instantly on a context already cancelled.
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), timeout)
+	defer drainCancel()
+	d.drainCtx = drainCtx
+
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-drainCtx.Done():
+	}
+}
+
+// Stats returns a snapshot of the background dispatcher's counters.
+func (c *Client) Stats() Stats {
+	return Stats{Dropped: atomic.LoadUint64(&c.dropped)}
+}
+
+// ReportAsync builds a notice for e, the same way Report does, and enqueues
+// it for delivery by the dispatcher started with Start. It never blocks: if
+// the dispatcher hasn't been started, it returns false, and if the queue is
+// full the oldest pending notice is dropped to make room (incrementing
+// Stats().Dropped) before the new one is queued.
+func (c *Client) ReportAsync(e interface{}) (queued bool) {
+	c.mu.Lock()
+	d := c.dispatcher
+	c.mu.Unlock()
+
+	if d == nil {
+		return false
+	}
+
+	notice := c.buildNotice(e, 2, context.Background(), nil, nil)
+
+	return c.enqueue(d, notice)
+}
+
+// enqueue queues notice on d, same as ReportAsync: non-blocking, dropping
+// the oldest queued notice to make room (incrementing Stats().Dropped) if
+// the queue is full.
+func (c *Client) enqueue(d *dispatcher, notice map[string]interface{}) (queued bool) {
+	select {
+	case d.queue <- notice:
+		return true
+	default:
+	}
+
+	select {
+	case <-d.queue:
+		atomic.AddUint64(&c.dropped, 1)
+	default:
+	}
+
+	select {
+	case d.queue <- notice:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) runWorker(ctx context.Context, d *dispatcher) {
+	defer d.wg.Done()
+
+	batchSize := c.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	flushInterval := c.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	batch := make([]map[string]interface{}, 0, batchSize)
+
+	var timerC <-chan time.Time
+	if batchSize > 1 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		timerC = ticker.C
+	}
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c.deliver(ctx, batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case notice := <-d.queue:
+			batch = append(batch, notice)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-timerC:
+			flush()
+		case <-ctx.Done():
+			drainCtx := d.drainCtx
+			if drainCtx == nil {
+				// ctx was cancelled by its caller rather than by Stop (no
+				// drain deadline was set); fall back to a bounded drain of
+				// our own so delivery still gets a real context.
+				var cancel context.CancelFunc
+				drainCtx, cancel = context.WithTimeout(context.Background(), DefaultStopTimeout)
+				defer cancel()
+			}
+			for {
+				select {
+				case notice := <-d.queue:
+					batch = append(batch, notice)
+				default:
+					for len(batch) > 0 {
+						n := batchSize
+						if n > len(batch) {
+							n = len(batch)
+						}
+						c.deliver(drainCtx, batch[:n])
+						batch = batch[n:]
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver marshals a batch of notices, reusing the same JSON shape Report
+// sends for a single notice, and hands it off for delivery with retries.
+// BeforeNotify hooks run per notice first, dropping any batch members they
+// skip; if every notice in the batch is dropped, nothing is sent.
+func (c *Client) deliver(ctx context.Context, notices []map[string]interface{}) {
+	kept := notices[:0:0]
+	for _, notice := range notices {
+		if c.runBeforeNotify(notice) {
+			kept = append(kept, notice)
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	var body []byte
+	var err error
+	if len(kept) == 1 {
+		body, err = json.Marshal(kept[0])
+	} else {
+		body, err = json.Marshal(kept)
+	}
+	if err != nil {
+		return
+	}
+
+	body, contentEncoding, err := c.compress(body)
+	if err != nil {
+		return
+	}
+
+	c.postWithRetry(ctx, body, contentEncoding)
+}
+
+// postWithRetry POSTs body to c.Endpoint, retrying 429/5xx responses and
+// network errors with exponential backoff and jitter, honoring a
+// Retry-After header when present, until Client.MaxElapsedTime
+// (DefaultMaxElapsedTime if unset) has elapsed.
+func (c *Client) postWithRetry(ctx context.Context, body []byte, contentEncoding string) {
+	maxElapsed := c.MaxElapsedTime
+	if maxElapsed <= 0 {
+		maxElapsed = DefaultMaxElapsedTime
+	}
+
+	deadline := time.Now().Add(maxElapsed)
+	backoff := initialBackoff
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("accept", "application/json")
+		req.Header.Set("content-type", "application/json")
+		req.Header.Set("x-api-key", c.APIKey)
+		if contentEncoding != "" {
+			req.Header.Set("content-encoding", contentEncoding)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		wait := jitter(backoff)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode/100 == 2 {
+				return
+			}
+			if res.StatusCode != http.StatusTooManyRequests && res.StatusCode/100 != 5 {
+				return
+			}
+			if ra, ok := retryAfter(res.Header.Get("Retry-After")); ok && ra > wait {
+				wait = ra
+			}
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, which may be either a number of
+// seconds or an HTTP date, per RFC 7231.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// jitter returns a random duration in [d/2, d], so retrying workers don't
+// all wake up at the same instant.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2+1)))
+}
+
+// formatMessage reduces e to the string Report and ReportAsync use as a
+// notice's message, so both send identical payloads for the same input.
+func formatMessage(e interface{}) string {
+	switch e := e.(type) {
+	case error:
+		return e.Error()
+	default:
+		return fmt.Sprintf("%v", e)
+	}
+}
@@ -0,0 +1,104 @@
+package honeybadger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReportAsyncDropsOldestWhenQueueFull(t *testing.T) {
+	c := New("test-api-key")
+	c.QueueSize = 2
+
+	c.mu.Lock()
+	c.dispatcher = &dispatcher{queue: make(chan map[string]interface{}, c.QueueSize)}
+	c.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		if queued := c.ReportAsync("boom"); !queued {
+			t.Fatalf("ReportAsync(%d): expected queued, got false", i)
+		}
+	}
+
+	if got := c.Stats().Dropped; got != 1 {
+		t.Errorf("Stats().Dropped = %d, want 1", got)
+	}
+	if got := len(c.dispatcher.queue); got != 2 {
+		t.Errorf("len(queue) = %d, want 2", got)
+	}
+}
+
+func TestPostWithRetryRetriesUntilSuccess(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c := New("test-api-key")
+	c.Endpoint = srv.URL
+
+	start := time.Now()
+	c.postWithRetry(context.Background(), []byte(`{}`), "")
+	elapsed := time.Since(start)
+
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+	if elapsed < initialBackoff {
+		t.Errorf("postWithRetry returned after %s, expected its backoff across both retries to total at least %s", elapsed, initialBackoff)
+	}
+}
+
+func TestStopDrainRespectsBatchSize(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c := New("test-api-key")
+	c.Endpoint = srv.URL
+	c.QueueSize = 10
+	c.BatchSize = 2
+
+	c.Start(context.Background())
+	for i := 0; i < 5; i++ {
+		c.ReportAsync("boom")
+	}
+	c.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(bodies) == 0 {
+		t.Fatal("expected at least one delivered request")
+	}
+	for _, body := range bodies {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			// A single-notice body is a JSON object, not an array; that's
+			// one notice, well within BatchSize.
+			continue
+		}
+		if len(batch) > c.BatchSize {
+			t.Errorf("delivered batch of %d notices, want at most BatchSize %d", len(batch), c.BatchSize)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package honeybadger
 
+import "context"
+
 // A Context represents a Honeybadger context and contains a mapping of keys to
 // arbitrary values. The context is serialized into JSON and sent to Honeybadger
 // along with reported notices.
@@ -22,3 +24,38 @@ func (ctx Context) Set(key string, value interface{}) {
 func (ctx Context) Del(key string) {
 	delete(ctx, key)
 }
+
+// contextKey is unexported so only this package can populate the
+// context.Context value it names.
+type contextKey struct{}
+
+// FromContext returns the per-request Context attached to ctx by Handler or
+// HandlerFunc. Calling Set on it records details scoped to the current
+// request without mutating Client.Context or any other request's Context.
+// Outside of a request served through the middleware, FromContext returns a
+// fresh, unattached Context.
+func FromContext(ctx context.Context) Context {
+	if reqCtx, ok := ctx.Value(contextKey{}).(Context); ok {
+		return reqCtx
+	}
+	return make(Context)
+}
+
+// withRequestContext returns a copy of ctx carrying a fresh Context that
+// handlers can retrieve with FromContext.
+func withRequestContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, make(Context))
+}
+
+// mergeContext returns a new Context holding base's entries overlaid with
+// override's, leaving both arguments unmodified.
+func mergeContext(base, override Context) Context {
+	merged := make(Context, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,147 @@
+package honeybadger
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// errorFrames returns the backtrace for err, preferring frames the error
+// itself recorded over the call stack at the point Report was invoked: a
+// Callers() []uintptr method (this package's own convention, also used by
+// errors packages that capture runtime.Callers directly), or a
+// StackTrace() method matching github.com/pkg/errors' convention, detected
+// by reflection so this package doesn't need to depend on it.
+func (c *Client) errorFrames(err error) ([]map[string]interface{}, bool) {
+	if tracer, ok := err.(interface{ Callers() []uintptr }); ok {
+		return c.framesFromPCs(tracer.Callers()), true
+	}
+	return c.pkgErrorsFrames(err)
+}
+
+func (c *Client) framesFromPCs(pcs []uintptr) []map[string]interface{} {
+	frames := []map[string]interface{}{}
+	if len(pcs) == 0 {
+		return frames
+	}
+
+	iter := runtime.CallersFrames(pcs)
+	for {
+		frame, more := iter.Next()
+		frames = append(frames, map[string]interface{}{
+			"file":   c.filterPath(frame.File),
+			"number": frame.Line,
+			"method": frame.Function,
+		})
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// pkgErrorsFrames detects and decodes github.com/pkg/errors' StackTrace()
+// method without importing that package: a pkg/errors.Frame prints as
+// "function\n\tfile:line" under "%+v", which is the only contract we rely
+// on.
+func (c *Client) pkgErrorsFrames(err error) ([]map[string]interface{}, bool) {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return nil, false
+	}
+
+	trace := method.Call(nil)[0]
+	if trace.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	frames := make([]map[string]interface{}, 0, trace.Len())
+	for i := 0; i < trace.Len(); i++ {
+		function, file, line := parsePkgErrorsFrame(fmt.Sprintf("%+v", trace.Index(i).Interface()))
+		frames = append(frames, map[string]interface{}{
+			"file":   c.filterPath(file),
+			"number": line,
+			"method": function,
+		})
+	}
+	return frames, true
+}
+
+func parsePkgErrorsFrame(text string) (function, file string, line int) {
+	parts := strings.SplitN(text, "\n\t", 2)
+	function = strings.TrimSpace(parts[0])
+	if len(parts) != 2 {
+		return function, "", 0
+	}
+
+	idx := strings.LastIndex(parts[1], ":")
+	if idx < 0 {
+		return function, parts[1], 0
+	}
+
+	file = parts[1][:idx]
+	line, _ = strconv.Atoi(parts[1][idx+1:])
+	return function, file, line
+}
+
+// maxCauses bounds how many links of an error's Unwrap/Causes chain
+// buildCauses will emit, guarding against a cyclical or runaway Unwrap
+// implementation. A cause's dynamic type isn't guaranteed to be comparable,
+// so a bound on the walk stands in for a "seen" set keyed by the errors
+// themselves.
+const maxCauses = 10
+
+// buildCauses walks err's Unwrap/Causes chain and returns a flat list of
+// every cause found (up to maxCauses), each with its own class, message,
+// and backtrace (empty if the cause doesn't carry its own stack-trace
+// information).
+func (c *Client) buildCauses(err error) []map[string]interface{} {
+	var causes []map[string]interface{}
+	queue := causesOf(err)
+
+	for len(queue) > 0 && len(causes) < maxCauses {
+		next := queue[0]
+		queue = queue[1:]
+		if next == nil {
+			continue
+		}
+
+		backtrace, _ := c.errorFrames(next)
+		if backtrace == nil {
+			backtrace = []map[string]interface{}{}
+		}
+
+		causes = append(causes, map[string]interface{}{
+			"class":     reflect.TypeOf(next).String(),
+			"message":   next.Error(),
+			"backtrace": backtrace,
+		})
+
+		queue = append(queue, causesOf(next)...)
+	}
+
+	return causes
+}
+
+// causesOf returns err's direct children via the standard library's single
+// Unwrap() error, Go 1.20's multi-error Unwrap() []error, and the
+// Unwrap()/Causes() []error convention used by some third-party error
+// packages.
+func causesOf(err error) []error {
+	var children []error
+
+	if u := errors.Unwrap(err); u != nil {
+		children = append(children, u)
+	}
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		children = append(children, multi.Unwrap()...)
+	}
+	if causer, ok := err.(interface{ Causes() []error }); ok {
+		children = append(children, causer.Causes()...)
+	}
+
+	return children
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hashrabbit/honeybadger-go"
+)
+
+var hb = honeybadger.New("changeme")
+
+func main() {
+	// chi exposes the matched route pattern (e.g. "/widgets/{id}") rather
+	// than the raw URL, keeping notices grouped instead of one-per-ID.
+	hb.RouteParamsFunc = func(r *http.Request) map[string]string {
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil {
+			return nil
+		}
+
+		params := make(map[string]string, len(rctx.URLParams.Keys))
+		for i, key := range rctx.URLParams.Keys {
+			params[key] = rctx.URLParams.Values[i]
+		}
+		params["route_pattern"] = rctx.RoutePattern()
+		return params
+	}
+
+	r := chi.NewRouter()
+	r.Get("/widgets/{id}", hb.HandlerFunc(showWidget))
+	http.ListenAndServe(":8080", r)
+}
+
+func showWidget(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	honeybadger.FromContext(r.Context()).Set("widget_id", id)
+	panic("widget lookup failed")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hashrabbit/honeybadger-go"
+)
+
+var hb = honeybadger.New("changeme")
+
+func main() {
+	// gorilla/mux exposes the matched route's template and captured
+	// variables, which we attach in place of the raw URL.
+	hb.RouteParamsFunc = func(r *http.Request) map[string]string {
+		params := make(map[string]string)
+		for k, v := range mux.Vars(r) {
+			params[k] = v
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				params["route_pattern"] = tpl
+			}
+		}
+		return params
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/widgets/{id}", hb.HandlerFunc(showWidget))
+	http.ListenAndServe(":8080", r)
+}
+
+func showWidget(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	honeybadger.FromContext(r.Context()).Set("widget_id", id)
+	panic("widget lookup failed")
+}
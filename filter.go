@@ -0,0 +1,109 @@
+package honeybadger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// filteredPlaceholder replaces any notice value matched by filterNotice.
+const filteredPlaceholder = "[FILTERED]"
+
+// defaultParamFilters covers the keys most often used to carry credentials
+// into Context, cgi_data, or request params. ParamFilters is appended to
+// this list rather than replacing it.
+var defaultParamFilters = []string{
+	"password",
+	"password_confirmation",
+	"secret",
+	"token",
+	"api_key",
+	"authorization",
+	"cookie",
+	"set-cookie",
+	"csrf",
+}
+
+// AddFilter registers fn to run last, after the default and ParamFilters
+// key-based redaction, so callers can filter on conditions those can't
+// express, such as a value's shape rather than its key.
+func (c *Client) AddFilter(fn func(notice map[string]interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.customFilters = append(c.customFilters, fn)
+}
+
+// filterNotice redacts sensitive values from notice in place. Any map key
+// matching a default or ParamFilters pattern has its value replaced with
+// "[FILTERED]", recursing into nested map[string]interface{}, Context, and
+// []interface{} values. The AddFilter hooks then run, in registration
+// order, on the already-redacted notice.
+func (c *Client) filterNotice(notice map[string]interface{}) {
+	patterns := make([]string, 0, len(defaultParamFilters)+len(c.ParamFilters))
+	patterns = append(patterns, defaultParamFilters...)
+	patterns = append(patterns, c.ParamFilters...)
+
+	filterValue(notice, patterns)
+
+	c.mu.Lock()
+	hooks := c.customFilters
+	c.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(notice)
+	}
+}
+
+// filterValue walks v, redacting matching keys of any map it finds.
+func filterValue(v interface{}, patterns []string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if keyMatches(k, patterns) {
+				val[k] = filteredPlaceholder
+				continue
+			}
+			filterValue(child, patterns)
+		}
+	case Context:
+		for k, child := range val {
+			if keyMatches(k, patterns) {
+				val[k] = filteredPlaceholder
+				continue
+			}
+			filterValue(child, patterns)
+		}
+	case []interface{}:
+		for _, child := range val {
+			filterValue(child, patterns)
+		}
+	case []map[string]interface{}:
+		for _, child := range val {
+			filterValue(child, patterns)
+		}
+	case map[string]string:
+		for k := range val {
+			if keyMatches(k, patterns) {
+				val[k] = filteredPlaceholder
+			}
+		}
+	}
+}
+
+// keyMatches reports whether key should be redacted under patterns. Each
+// pattern is tried first as a regexp and, failing that (or on a non-match),
+// as a case-insensitive substring, so callers can use either a plain word
+// like "password" or something like "(?i)^x-auth-".
+func keyMatches(key string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		if re, err := regexp.Compile(p); err == nil && re.MatchString(key) {
+			return true
+		}
+		if strings.Contains(strings.ToLower(key), strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package honeybadger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFilterNoticeRedactsNestedCredentials(t *testing.T) {
+	c := New("test-api-key")
+	c.Context.Set("user", map[string]interface{}{
+		"name":     "alice",
+		"password": "hunter2",
+		"tokens": []interface{}{
+			map[string]interface{}{"api_key": "sk-live-abc123"},
+		},
+	})
+
+	notice := c.buildNotice("boom", 0, nil, nil, nil)
+
+	jsonBody, err := json.Marshal(notice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	body := string(jsonBody)
+
+	for _, leaked := range []string{"hunter2", "sk-live-abc123"} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("expected %q to be filtered from notice body, got: %s", leaked, body)
+		}
+	}
+
+	if !strings.Contains(body, filteredPlaceholder) {
+		t.Errorf("expected %q in notice body, got: %s", filteredPlaceholder, body)
+	}
+}
+
+func TestFilterNoticeRedactsRouteParams(t *testing.T) {
+	c := New("test-api-key")
+	c.RouteParamsFunc = func(r *http.Request) map[string]string {
+		return map[string]string{
+			"id":    "42",
+			"token": "sk-secret-leak",
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/widgets/42", nil)
+	notice := c.buildNotice("boom", 0, nil, r, nil)
+
+	jsonBody, err := json.Marshal(notice)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	body := string(jsonBody)
+
+	if strings.Contains(body, "sk-secret-leak") {
+		t.Errorf("expected route param %q to be filtered from notice body, got: %s", "token", body)
+	}
+
+	if !strings.Contains(body, filteredPlaceholder) {
+		t.Errorf("expected %q in notice body, got: %s", filteredPlaceholder, body)
+	}
+}
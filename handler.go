@@ -0,0 +1,69 @@
+package honeybadger
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// panicReportTimeout bounds recoverAndReport's synchronous send when no
+// background dispatcher is running, so a Honeybadger endpoint that never
+// responds can't delay the 500 it's about to write.
+const panicReportTimeout = 5 * time.Second
+
+// Handler wraps next so that any panic escaping it is recovered, reported to
+// Honeybadger with the request's method, URL, remote address, and headers
+// attached, and turned into a 500 response instead of crashing the server.
+// It also attaches a per-request Context to r's context, retrievable with
+// FromContext, so handlers can record request-scoped details such as a user
+// ID without mutating the shared Client.Context:
+//
+//	honeybadger.FromContext(r.Context()).Set("user_id", userID)
+//
+// Route params aren't extracted by Handler itself; set RouteParamsFunc to a
+// function matching your router (see the chi and gorilla/mux adapters under
+// example/) so reported notices carry them instead of raw, high-cardinality
+// URLs.
+func (c *Client) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(withRequestContext(r.Context()))
+		defer c.recoverAndReport(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandlerFunc is Handler for an http.HandlerFunc.
+func (c *Client) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Handler(next).ServeHTTP(w, r)
+	}
+}
+
+// recoverAndReport reports a panic recovered from next, if any, and writes a
+// 500 response in its place. If Start has been called, the notice is
+// queued on the background dispatcher, same as ReportAsync, so a slow or
+// unreachable Honeybadger endpoint can never delay the 500; otherwise it
+// falls back to a synchronous send bounded by panicReportTimeout (Timeout,
+// if set, still applies on top of that in send).
+func (c *Client) recoverAndReport(w http.ResponseWriter, r *http.Request) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	notice := c.buildNotice(rec, 2, nil, r, nil)
+
+	c.mu.Lock()
+	d := c.dispatcher
+	c.mu.Unlock()
+
+	if d != nil {
+		c.enqueue(d, notice)
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), panicReportTimeout)
+		defer cancel()
+		c.send(ctx, notice)
+	}
+
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -5,20 +5,29 @@ package honeybadger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	DefaultEndpoint     = "https://api.honeybadger.io/v1/notices"
 	DefaultNotifierName = "honeybadger-go"
 	DefaultNotifierURL  = "https://github.com/hashrabbit/honeybadger-go"
+
+	// DefaultEnvironment is used when neither Client.Environment nor the
+	// HONEYBADGER_ENV environment variable is set.
+	DefaultEnvironment = "production"
 )
 
 type Client struct {
@@ -43,10 +52,104 @@ type Client struct {
 	// NotifierURL references the homepage of the library responsible for
 	// sending notices.
 	NotifierURL string
+
+	// QueueSize is the number of built notices the background dispatcher
+	// started by Start will buffer before ReportAsync starts dropping the
+	// oldest queued notice. Defaults to DefaultQueueSize.
+	QueueSize int
+
+	// Workers is the number of goroutines the background dispatcher uses to
+	// deliver queued notices concurrently. Defaults to DefaultWorkers.
+	Workers int
+
+	// BatchSize is the number of notices a dispatcher worker will combine
+	// into a single HTTP request. Values greater than 1 require an endpoint
+	// that accepts a JSON array of notices. Defaults to no batching.
+	BatchSize int
+
+	// FlushInterval is the longest a worker will hold a partial batch before
+	// sending it, when BatchSize > 1. Defaults to DefaultFlushInterval.
+	FlushInterval time.Duration
+
+	// MaxElapsedTime bounds how long a worker will keep retrying a failed
+	// delivery before giving up on it. Defaults to DefaultMaxElapsedTime.
+	MaxElapsedTime time.Duration
+
+	// StopTimeout bounds how long Stop will wait for in-flight and queued
+	// notices to drain before returning. Defaults to DefaultStopTimeout.
+	StopTimeout time.Duration
+
+	// RouteParamsFunc extracts router-matched parameters (e.g. chi's
+	// URLParam names or gorilla/mux's Vars) from a request served through
+	// Handler or HandlerFunc, so they're attached to reported notices as
+	// "request.params". Left nil, no params are attached.
+	RouteParamsFunc func(*http.Request) map[string]string
+
+	// ParamFilters lists additional substrings (matched case-insensitively)
+	// or regexps (case-sensitive unless they use "(?i)") against keys in
+	// Context, cgi_data, and request params, whose values are replaced with
+	// "[FILTERED]" before a notice
+	// is marshaled. It's appended to a built-in list covering the usual
+	// suspects (password, token, authorization, cookie, and the like).
+	ParamFilters []string
+
+	// DisableStackLocals, when true, omits local variable values from
+	// reported stack frames. The backtrace format stacktraceFrames
+	// produces never includes per-frame locals, so this is a no-op today;
+	// it's reserved for a future backtrace format that does.
+	DisableStackLocals bool
+
+	// FileFilter runs after filterPath's GOROOT/ProjectRoot substitution,
+	// letting callers redact or rewrite file paths further (e.g. stripping
+	// a vendor directory's absolute prefix) before they reach a notice.
+	FileFilter func(path string) string
+
+	// Timeout bounds how long ReportContext (and Report, which delegates
+	// to it) waits for the outbound POST to complete, by wrapping the
+	// supplied context.Context in a context.WithTimeout. Zero means no
+	// additional deadline beyond whatever the context already carries.
+	Timeout time.Duration
+
+	// RequestIDFunc, if set, pulls a correlation or request ID out of the
+	// context.Context passed to ReportContext (or, for a request served
+	// through Handler/HandlerFunc, the request's own context) and attaches
+	// it to the notice's "request" map as "request_id".
+	RequestIDFunc func(context.Context) string
+
+	// Environment is reported as "server.environment_name". Defaults to the
+	// HONEYBADGER_ENV environment variable, or DefaultEnvironment if that's
+	// unset too.
+	Environment string
+
+	// Revision is reported as "server.revision", letting Honeybadger tie a
+	// notice to the build that produced it. Defaults to whatever
+	// DetectRevision() finds in the binary's embedded VCS info.
+	Revision string
+
+	// Compress, when true, gzips the JSON request body and sets
+	// Content-Encoding: gzip.
+	Compress bool
+
+	// BeforeNotify hooks run, in order, on a built notice just before it's
+	// marshaled to JSON. A hook can mutate notice in place (e.g. to scrub
+	// or enrich it) or return an error to drop the notice silently; return
+	// ErrSkipNotice for that purpose to make the intent explicit, e.g. to
+	// sample or to ignore a known-noisy error like context.Canceled.
+	BeforeNotify []func(notice map[string]interface{}) error
+
+	mu            sync.Mutex
+	dispatcher    *dispatcher
+	dropped       uint64
+	customFilters []func(notice map[string]interface{})
 }
 
 // New returns a new honeybadger.Client with apiKey for sending notices.
 func New(apiKey string) *Client {
+	environment := os.Getenv("HONEYBADGER_ENV")
+	if environment == "" {
+		environment = DefaultEnvironment
+	}
+
 	return &Client{
 		APIKey:       apiKey,
 		ProjectRoot:  detectProjectRoot(),
@@ -54,6 +157,8 @@ func New(apiKey string) *Client {
 		Endpoint:     DefaultEndpoint,
 		NotifierName: DefaultNotifierName,
 		NotifierURL:  DefaultNotifierURL,
+		Environment:  environment,
+		Revision:     DetectRevision(),
 	}
 }
 
@@ -77,26 +182,59 @@ func detectProjectRoot() string {
 
 // Report sends a message to Honeybadger along with additional information
 // (stacktrace, Go version, architecture, and operating system) and Context.
-// Returns Honeybadger error ID for informing end-users.
+// If e is an error, its dynamic type and Unwrap/Causes chain are reported
+// too, so Honeybadger can group and display them. Returns Honeybadger error
+// ID for informing end-users. Report delegates to ReportContext with
+// context.Background(); use ReportContext directly to have the outbound
+// POST cancelled when a caller's context is.
 func (c *Client) Report(e interface{}) (string, error) {
-	msg := ""
-	switch e := e.(type) {
-	case error:
-		msg = e.Error()
-	default:
-		msg = fmt.Sprintf("%v", e)
+	return c.ReportContext(context.Background(), e)
+}
+
+// ReportContext is Report, but ctx is passed to the outbound HTTP request
+// (so server shutdown or a cancelled request aborts delivery instead of
+// leaking a goroutine pinned on a hung endpoint), bounded by Client.Timeout
+// if set, and used to pull a correlation ID via RequestIDFunc and merge in
+// any per-request Context attached by Handler/HandlerFunc.
+func (c *Client) ReportContext(ctx context.Context, e interface{}) (string, error) {
+	return c.send(ctx, c.buildNotice(e, 2, ctx, nil, nil))
+}
+
+// ReportWithTags is Report with tags attached to the notice's top-level
+// "tags" field, for grouping or filtering notices on Honeybadger's side
+// when class-based grouping alone isn't specific enough.
+func (c *Client) ReportWithTags(e interface{}, tags ...string) (string, error) {
+	return c.send(context.Background(), c.buildNotice(e, 2, context.Background(), nil, tags))
+}
+
+// send marshals notice and POSTs it to c.Endpoint synchronously, the same
+// way Report always has, bounding the request by Client.Timeout if set and
+// aborting early if ctx is done. ReportAsync's dispatcher delivers through
+// postWithRetry instead, since it needs retries as well as cancellation.
+func (c *Client) send(ctx context.Context, notice map[string]interface{}) (string, error) {
+	if !c.runBeforeNotify(notice) {
+		return "", nil
 	}
 
-	notice := c.buildNotice(msg, 2)
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
 	jsonBody, err := json.Marshal(notice)
 	if err != nil {
 		return "", err
 	}
 
+	body, contentEncoding, err := c.compress(jsonBody)
+	if err != nil {
+		return "", err
+	}
+
 	client := &http.Client{}
 
-	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
@@ -104,12 +242,15 @@ func (c *Client) Report(e interface{}) (string, error) {
 	req.Header.Set("accept", "application/json")
 	req.Header.Set("content-type", "application/json")
 	req.Header.Set("x-api-key", c.APIKey)
+	if contentEncoding != "" {
+		req.Header.Set("content-encoding", contentEncoding)
+	}
 
 	res, err := client.Do(req)
-	defer res.Body.Close()
 	if err != nil {
 		return "", err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode/100 != 2 { // 200, 201, 202, etc
 		return "", fmt.Errorf("unexpected status code %d", res.StatusCode)
@@ -124,37 +265,106 @@ func (c *Client) Reportf(format string, params ...interface{}) (string, error) {
 	return c.Report(fmt.Sprintf(format, params...))
 }
 
-func (c *Client) buildNotice(message string, skip int) map[string]interface{} {
+// buildNotice assembles the notice payload shared by Report, ReportAsync,
+// and the HTTP middleware. r is nil outside of a request; when present, its
+// method, URL, remote address, and headers are folded into cgi_data (CGI's
+// HTTP_* convention), route params extracted by RouteParamsFunc are
+// attached, and its context (which takes precedence over ctx, since it's
+// the one Handler/HandlerFunc attached a per-request Context to) supplies
+// RequestIDFunc and the per-request Context merged over c.Context, without
+// mutating either. When e is an error, its dynamic type becomes the
+// notice's class, its Unwrap/Causes chain becomes the "causes" array, and a
+// stack-trace-carrying error (pkg/errors' StackTrace, or a
+// Callers() []uintptr) supplies the backtrace instead of the call stack at
+// the point Report was invoked.
+func (c *Client) buildNotice(e interface{}, skip int, ctx context.Context, r *http.Request, tags []string) map[string]interface{} {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = ""
 	}
 
-	return map[string]interface{}{
+	message := formatMessage(e)
+	class := ""
+	backtrace := c.stacktraceFrames(3 + skip)
+	var causes []map[string]interface{}
+
+	if reportedErr, ok := e.(error); ok {
+		class = reflect.TypeOf(reportedErr).String()
+		if frames, ok := c.errorFrames(reportedErr); ok {
+			backtrace = frames
+		}
+		causes = c.buildCauses(reportedErr)
+	}
+
+	cgiData := map[string]interface{}{
+		"GOARCH": runtime.GOARCH,
+		"GOOS":   runtime.GOOS,
+		"GOVER":  runtime.Version(),
+	}
+
+	var params map[string]string
+
+	if r != nil {
+		ctx = r.Context()
+
+		cgiData["REQUEST_METHOD"] = r.Method
+		cgiData["REQUEST_URI"] = r.URL.String()
+		cgiData["REMOTE_ADDR"] = r.RemoteAddr
+		for name, values := range r.Header {
+			// Sensitive headers (Cookie, Authorization, ...) are redacted
+			// by filterNotice below, along with the rest of the notice.
+			key := "HTTP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+			cgiData[key] = strings.Join(values, ", ")
+		}
+
+		if c.RouteParamsFunc != nil {
+			params = c.RouteParamsFunc(r)
+		}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Copy c.Context rather than aliasing it: filterNotice redacts matching
+	// entries in place, and the client-wide Context must survive unchanged
+	// across calls.
+	requestContext := mergeContext(c.Context, FromContext(ctx))
+
+	requestID := ""
+	if c.RequestIDFunc != nil {
+		requestID = c.RequestIDFunc(ctx)
+	}
+
+	notice := map[string]interface{}{
 		"notifier": map[string]interface{}{
 			"name":     c.NotifierName,
 			"url":      c.NotifierURL,
 			"language": "go",
 		},
 		"error": map[string]interface{}{
-			"class":     "",
+			"class":     class,
 			"message":   message,
-			"backtrace": c.stacktraceFrames(3 + skip),
+			"backtrace": backtrace,
 		},
 		"request": map[string]interface{}{
-			"cgi_data": map[string]interface{}{
-				"GOARCH": runtime.GOARCH,
-				"GOOS":   runtime.GOOS,
-				"GOVER":  runtime.Version(),
-			},
-			"context": c.Context,
+			"cgi_data":   cgiData,
+			"params":     params,
+			"context":    requestContext,
+			"request_id": requestID,
 		},
 		"server": map[string]interface{}{
-			"environment_name": "production",
+			"environment_name": c.Environment,
 			"hostname":         hostname,
 			"project_root":     c.ProjectRoot,
+			"revision":         c.Revision,
 		},
+		"causes": causes,
+		"tags":   tags,
 	}
+
+	c.filterNotice(notice)
+
+	return notice
 }
 
 var rootFilter = regexp.MustCompile("^" + regexp.QuoteMeta(runtime.GOROOT()))
@@ -167,6 +377,10 @@ func (c *Client) filterPath(file string) string {
 		file = projectPat.ReplaceAllString(file, "[PROJECT_ROOT]")
 	}
 
+	if c.FileFilter != nil {
+		file = c.FileFilter(file)
+	}
+
 	return file
 }
 
@@ -0,0 +1,64 @@
+package honeybadger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"runtime/debug"
+)
+
+// ErrSkipNotice is the conventional sentinel a BeforeNotify hook returns to
+// drop a notice silently, e.g. to sample noisy errors or ignore
+// context.Canceled. Any other error returned from a hook drops the notice
+// the same way; ErrSkipNotice just documents the intent at the call site.
+var ErrSkipNotice = errors.New("honeybadger: notice skipped by BeforeNotify hook")
+
+// DetectRevision returns the VCS revision embedded in the running binary by
+// the Go toolchain (the "vcs.revision" build setting), or "" if the binary
+// wasn't built with module and VCS information available. New uses this to
+// default Client.Revision.
+func DetectRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// runBeforeNotify runs c.BeforeNotify against notice in order, returning
+// false as soon as one returns an error, meaning the caller should drop the
+// notice without sending it.
+func (c *Client) runBeforeNotify(notice map[string]interface{}) bool {
+	for _, hook := range c.BeforeNotify {
+		if err := hook(notice); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compress gzips body and returns it along with the Content-Encoding value
+// to send it under, or returns body unchanged with no encoding when
+// Client.Compress is false.
+func (c *Client) compress(body []byte) ([]byte, string, error) {
+	if !c.Compress {
+		return body, "", nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "gzip", nil
+}